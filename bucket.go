@@ -0,0 +1,280 @@
+package inmemdb
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBucketExists is returned when the provided bucket name is
+// already in use.
+var ErrBucketExists = errors.New("bucket already exists")
+
+// ErrBucketNotFound is returned when the provided bucket name has no
+// matching Bucket.
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// ErrBucketNotDurable is returned by CreateBucket when called on a
+// Database opened via OpenDatabase. Bucket contents are kept only in
+// memory: they are never appended to the write-ahead log nor included
+// in a Checkpoint snapshot, so creating one on a durable Database
+// would silently lose its data across a restart.
+var ErrBucketNotDurable = errors.New("buckets are not durable and cannot be created on a database opened with OpenDatabase")
+
+// Bucket is a named, isolated key space within a Database. Two
+// buckets can hold the same key without colliding, so callers don't
+// need to resort to key-prefix conventions to keep logical tables
+// apart.
+//
+// Bucket shares its parent Database's sequence counter, so versions
+// written to a bucket interleave correctly with versions written
+// to the default key space or to other buckets for the purposes of
+// snapshot isolation.
+//
+// Bucket data is not durable: see ErrBucketNotDurable.
+type Bucket struct {
+	name string
+	db   *Database
+
+	mu   sync.RWMutex
+	data map[string]*Entry
+	keys orderedKeys
+}
+
+func newBucket(name string, db *Database) *Bucket {
+	return &Bucket{name: name, db: db, data: make(map[string]*Entry), keys: newOrderedKeys()}
+}
+
+// Get returns the value associated with the provided key.
+func (b *Bucket) Get(key string) (string, error) {
+	if key == "" {
+		return "", ErrKeyEmpty
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	entry, ok := b.data[key]
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	v, ok := entry.latest()
+	if !ok || v.deleted {
+		return "", ErrKeyNotFound
+	}
+	return v.value, nil
+}
+
+// Put sets the provided key to value.
+func (b *Bucket) Put(key string, value string) error {
+	if key == "" {
+		return ErrKeyEmpty
+	}
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	seq := b.db.nextSeq()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if entry, ok := b.data[key]; ok {
+		entry.addVersion(version{seq: seq, value: value})
+		return nil
+	}
+	b.data[key] = NewEntry(seq, value)
+	b.keys.insert(key)
+	return nil
+}
+
+// Delete removes the value associated to the key provided.
+func (b *Bucket) Delete(key string) error {
+	if key == "" {
+		return ErrKeyEmpty
+	}
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+	seq := b.db.nextSeq()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	v, ok := entry.latest()
+	if !ok || v.deleted {
+		return ErrKeyNotFound
+	}
+	entry.addVersion(version{seq: seq, deleted: true})
+	return nil
+}
+
+// NewIterator returns an Iterator over the committed keys in rng, as
+// of now.
+func (b *Bucket) NewIterator(rng Range) Iterator {
+	b.db.mu.RLock()
+	seq := b.db.seq
+	b.db.mu.RUnlock()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return newSliceIterator(snapshotRange(b.data, b.keys, seq, rng))
+}
+
+// NewPrefixIterator returns an Iterator over every committed key
+// starting with prefix, as of now.
+func (b *Bucket) NewPrefixIterator(prefix string) Iterator {
+	return b.NewIterator(prefixRange(prefix))
+}
+
+// Bucket returns the named bucket, or nil if it doesn't exist.
+func (d *Database) Bucket(name string) *Bucket {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.buckets[name]
+}
+
+// CreateBucket creates and returns a new, empty bucket identified by
+// name.
+//
+// CreateBucket fails with ErrBucketNotDurable on a Database opened
+// via OpenDatabase, since bucket contents aren't persisted.
+func (d *Database) CreateBucket(name string) (*Bucket, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.persist != nil {
+		return nil, ErrBucketNotDurable
+	}
+	if d.buckets == nil {
+		d.buckets = make(map[string]*Bucket)
+	}
+	if _, ok := d.buckets[name]; ok {
+		return nil, ErrBucketExists
+	}
+	b := newBucket(name, d)
+	d.buckets[name] = b
+	return b, nil
+}
+
+// ForEachBucket calls fn for every bucket currently registered on
+// the database, in no particular order, stopping at (and returning)
+// the first error fn returns.
+func (d *Database) ForEachBucket(fn func(name string, b *Bucket) error) error {
+	d.mu.RLock()
+	buckets := make(map[string]*Bucket, len(d.buckets))
+	for name, b := range d.buckets {
+		buckets[name] = b
+	}
+	d.mu.RUnlock()
+
+	for name, b := range buckets {
+		if err := fn(name, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BucketTxn scopes Transaction reads/writes to a single named
+// Bucket.
+type BucketTxn struct {
+	name string
+	tx   *Transaction
+}
+
+// Bucket scopes the transaction to the named bucket. Writes made
+// through the returned BucketTxn are committed atomically with the
+// rest of the transaction.
+func (t *Transaction) Bucket(name string) *BucketTxn {
+	return &BucketTxn{name: name, tx: t}
+}
+
+func (bt *BucketTxn) writeSet() map[string]*UncommitedEntry {
+	tx := bt.tx
+	if tx.bucketWrites == nil {
+		tx.bucketWrites = make(map[string]map[string]*UncommitedEntry)
+	}
+	writes, ok := tx.bucketWrites[bt.name]
+	if !ok {
+		writes = make(map[string]*UncommitedEntry)
+		tx.bucketWrites[bt.name] = writes
+	}
+	return writes
+}
+
+// Get fetches a value associated to the provided key if it is
+// visible from the transaction's snapshot of the bucket.
+func (bt *BucketTxn) Get(key string) (string, error) {
+	if writes, ok := bt.tx.bucketWrites[bt.name]; ok {
+		if uEntry, ok := writes[key]; ok {
+			if uEntry.state == stateDeleted {
+				return "", ErrKeyNotFound
+			}
+			return *uEntry.newValue, nil
+		}
+	}
+	b := bt.tx.db.Bucket(bt.name)
+	if b == nil {
+		return "", ErrBucketNotFound
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if entry, ok := b.data[key]; ok {
+		if rec, ok := entry.at(bt.tx.seq); ok && !rec.deleted {
+			return rec.value, nil
+		}
+	}
+	return "", ErrKeyNotFound
+}
+
+// Put updates/creates an uncommitedEntry for key, scoped to the
+// bucket, and adds it to the transaction's local write-set.
+func (bt *BucketTxn) Put(key string, value string) error {
+	b := bt.tx.db.Bucket(bt.name)
+	if b == nil {
+		return ErrBucketNotFound
+	}
+	writes := bt.writeSet()
+	if uEntry, ok := writes[key]; ok {
+		if uEntry.state == stateDeleted {
+			uEntry.state = stateUpdated
+		}
+		uEntry.newValue = &value
+		return nil
+	}
+	state := stateAdded
+	b.mu.RLock()
+	if entry, ok := b.data[key]; ok {
+		if rec, ok := entry.at(bt.tx.seq); ok && !rec.deleted {
+			state = stateUpdated
+		}
+	}
+	b.mu.RUnlock()
+	writes[key] = &UncommitedEntry{newValue: &value, state: state}
+	return nil
+}
+
+// Delete udpates/creates an uncommitedEntry for key, scoped to the
+// bucket, and adds it to the transaction's local write-set.
+func (bt *BucketTxn) Delete(key string) error {
+	b := bt.tx.db.Bucket(bt.name)
+	if b == nil {
+		return ErrBucketNotFound
+	}
+	writes := bt.writeSet()
+	if uEntry, ok := writes[key]; ok {
+		if uEntry.state == stateAdded {
+			delete(writes, key)
+			return nil
+		}
+		uEntry.state = stateDeleted
+		uEntry.newValue = nil
+		return nil
+	}
+	b.mu.RLock()
+	_, visible := b.data[key]
+	if visible {
+		if rec, ok := b.data[key].at(bt.tx.seq); !ok || rec.deleted {
+			visible = false
+		}
+	}
+	b.mu.RUnlock()
+	if !visible {
+		return ErrKeyNotFound
+	}
+	writes[key] = &UncommitedEntry{state: stateDeleted}
+	return nil
+}
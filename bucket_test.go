@@ -0,0 +1,95 @@
+package inmemdb
+
+import "testing"
+
+func TestDatabaseCreateBucket(t *testing.T) {
+	db := stubDatabase(t)
+
+	b, err := db.CreateBucket("users")
+	if err != nil {
+		t.Fatalf("got error on CreateBucket but should have got nil: %v", err)
+	}
+	if db.Bucket("users") != b {
+		t.Errorf("got a different bucket from Bucket() than from CreateBucket()")
+	}
+
+	_, err = db.CreateBucket("users")
+	if err != ErrBucketExists {
+		t.Errorf("got error: %v, but wanted: %v", err, ErrBucketExists)
+	}
+
+	if db.Bucket("missing") != nil {
+		t.Errorf("got a bucket for a name that was never created")
+	}
+}
+
+func TestBucketGetPutDelete(t *testing.T) {
+	db := stubDatabase(t)
+	b, err := db.CreateBucket("users")
+	if err != nil {
+		t.Fatalf("got error on CreateBucket but should have got nil: %v", err)
+	}
+
+	if err := b.Put("key1", "value1"); err != nil {
+		t.Errorf("got error on Put but should have got nil: %v", err)
+	}
+	value, err := b.Get("key1")
+	if err != nil {
+		t.Errorf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+
+	// the same key in the default space must not be visible through
+	// the bucket, nor vice versa.
+	if err := db.Put("key1", "top-level"); err != nil {
+		t.Errorf("got error on Put but should have got nil: %v", err)
+	}
+	value, err = b.Get("key1")
+	if err != nil || value != "value1" {
+		t.Errorf("got value: %v, err: %v, but wanted: value1, nil", value, err)
+	}
+
+	if err := b.Delete("key1"); err != nil {
+		t.Errorf("got error on Delete but should have got nil: %v", err)
+	}
+	if _, err := b.Get("key1"); err != ErrKeyNotFound {
+		t.Errorf("got error: %v, but wanted: %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestTransactionBucketCommit(t *testing.T) {
+	db := stubDatabase(t)
+	b, err := db.CreateBucket("users")
+	if err != nil {
+		t.Fatalf("got error on CreateBucket but should have got nil: %v", err)
+	}
+
+	if err := db.CreateTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+	}
+	tx, err := db.Transaction("tx1")
+	if err != nil {
+		t.Fatalf("got error on Transaction but should have got nil: %v", err)
+	}
+
+	bt := tx.Bucket("users")
+	if err := bt.Put("key1", "value1"); err != nil {
+		t.Errorf("got error on Put but should have got nil: %v", err)
+	}
+	if _, err := b.Get("key1"); err != ErrKeyNotFound {
+		t.Errorf("got error: %v, but wanted: %v (uncommitted write should not be visible)", err, ErrKeyNotFound)
+	}
+
+	if err := db.CommitTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CommitTransaction but should have got nil: %v", err)
+	}
+	value, err := b.Get("key1")
+	if err != nil {
+		t.Errorf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+}
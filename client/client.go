@@ -0,0 +1,213 @@
+// Package client dials a server.Server and mirrors the
+// inmemdb.Database API over the wire.
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/devodev/inmemdb/server"
+)
+
+// Client is a connection to a server.Server. It is safe for
+// concurrent use: requests are serialized over the underlying
+// connection, each round trip holding a lock from writing its
+// request until its response is read, so responses are taken in
+// order and are not matched by request ID. Requests are not
+// pipelined, even over server.BinaryCodec.
+type Client struct {
+	codec server.Codec
+
+	writeMu sync.Mutex
+	conn    net.Conn
+	nextID  uint64
+
+	readMu sync.Mutex
+	r      *bufio.Reader
+}
+
+// Dial connects to a server.Server listening at addr, communicating
+// using codec. codec must match the one the server was constructed
+// with.
+func Dial(addr string, codec server.Codec) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("client: dial: %w", err)
+	}
+	return &Client{codec: codec, conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// Close closes the underlying connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// roundTrip holds writeMu from writing req until its response has
+// been read, so concurrent callers never read each other's replies:
+// TextCodec has no request ID to match a response to its request.
+// This also keeps BinaryCodec requests and their responses in
+// lock-step.
+func (c *Client) roundTrip(req server.Request) (server.Response, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	req.ID = atomic.AddUint64(&c.nextID, 1)
+	if err := c.codec.WriteRequest(c.conn, req); err != nil {
+		return server.Response{}, fmt.Errorf("client: write request: %w", err)
+	}
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	resp, err := c.codec.ReadResponse(c.r)
+	if err != nil {
+		return server.Response{}, fmt.Errorf("client: read response: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *Client) do(req server.Request) (string, error) {
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.Err != "" {
+		return "", fmt.Errorf("client: %s", resp.Err)
+	}
+	return resp.Value, nil
+}
+
+// Get returns the value associated with the provided key.
+func (c *Client) Get(key string) (string, error) {
+	return c.do(server.Request{Op: server.OpGet, Key: key})
+}
+
+// Put sets the provided key to value.
+func (c *Client) Put(key, value string) error {
+	_, err := c.do(server.Request{Op: server.OpPut, Key: key, Value: value})
+	return err
+}
+
+// Delete removes the value associated to the key provided.
+func (c *Client) Delete(key string) error {
+	_, err := c.do(server.Request{Op: server.OpDelete, Key: key})
+	return err
+}
+
+// CreateTransaction initializes a transaction for the provided
+// transaction ID, scoped to this connection.
+func (c *Client) CreateTransaction(xid string) error {
+	_, err := c.do(server.Request{Op: server.OpBegin, Xid: xid})
+	return err
+}
+
+// CommitTransaction applies uncommited changes to the database for
+// the provided transaction ID.
+func (c *Client) CommitTransaction(xid string) error {
+	_, err := c.do(server.Request{Op: server.OpCommit, Xid: xid})
+	return err
+}
+
+// RollbackTransaction reverts uncommited changes from the database
+// for the provided transaction ID.
+func (c *Client) RollbackTransaction(xid string) error {
+	_, err := c.do(server.Request{Op: server.OpRollback, Xid: xid})
+	return err
+}
+
+// GetTxn returns the value associated with the provided key within
+// an existing transaction using the provided transaction ID.
+func (c *Client) GetTxn(key, xid string) (string, error) {
+	return c.do(server.Request{Op: server.OpGetTxn, Key: key, Xid: xid})
+}
+
+// PutTxn sets the provided key to value within an existing
+// transaction using the provided transaction ID.
+func (c *Client) PutTxn(key, value, xid string) error {
+	_, err := c.do(server.Request{Op: server.OpPutTxn, Key: key, Value: value, Xid: xid})
+	return err
+}
+
+// DeleteTxn removes the value associated to the key provided within
+// an existing transaction using the provided transaction ID.
+func (c *Client) DeleteTxn(key, xid string) error {
+	_, err := c.do(server.Request{Op: server.OpDeleteTxn, Key: key, Xid: xid})
+	return err
+}
+
+// CreateBucket creates a new, empty bucket identified by name.
+func (c *Client) CreateBucket(name string) error {
+	_, err := c.do(server.Request{Op: server.OpCreateBucket, Bucket: name})
+	return err
+}
+
+// BucketGet returns the value associated with key in the named
+// bucket.
+func (c *Client) BucketGet(bucket, key string) (string, error) {
+	return c.do(server.Request{Op: server.OpGet, Key: key, Bucket: bucket})
+}
+
+// BucketPut sets key to value in the named bucket.
+func (c *Client) BucketPut(bucket, key, value string) error {
+	_, err := c.do(server.Request{Op: server.OpPut, Key: key, Value: value, Bucket: bucket})
+	return err
+}
+
+// BucketDelete removes the value associated with key in the named
+// bucket.
+func (c *Client) BucketDelete(bucket, key string) error {
+	_, err := c.do(server.Request{Op: server.OpDelete, Key: key, Bucket: bucket})
+	return err
+}
+
+// BucketGetTxn returns the value associated with key in the named
+// bucket, scoped to an existing transaction.
+func (c *Client) BucketGetTxn(bucket, key, xid string) (string, error) {
+	return c.do(server.Request{Op: server.OpGetTxn, Key: key, Bucket: bucket, Xid: xid})
+}
+
+// BucketPutTxn sets key to value in the named bucket, scoped to an
+// existing transaction.
+func (c *Client) BucketPutTxn(bucket, key, value, xid string) error {
+	_, err := c.do(server.Request{Op: server.OpPutTxn, Key: key, Value: value, Bucket: bucket, Xid: xid})
+	return err
+}
+
+// BucketDeleteTxn removes the value associated with key in the named
+// bucket, scoped to an existing transaction.
+func (c *Client) BucketDeleteTxn(bucket, key, xid string) error {
+	_, err := c.do(server.Request{Op: server.OpDeleteTxn, Key: key, Bucket: bucket, Xid: xid})
+	return err
+}
+
+// Scan returns every key/value pair in [start, limit), as bounded by
+// includeStart/includeLimit, as of now.
+func (c *Client) Scan(start, limit string, includeStart, includeLimit bool) ([]server.Pair, error) {
+	return c.scan(server.Request{Op: server.OpScan, RangeStart: start, RangeLimit: limit, IncludeStart: includeStart, IncludeLimit: includeLimit})
+}
+
+// ScanTxn returns every key/value pair in [start, limit), as bounded
+// by includeStart/includeLimit, merging the transaction's snapshot
+// with its own uncommitted writes.
+func (c *Client) ScanTxn(xid, start, limit string, includeStart, includeLimit bool) ([]server.Pair, error) {
+	return c.scan(server.Request{Op: server.OpScan, Xid: xid, RangeStart: start, RangeLimit: limit, IncludeStart: includeStart, IncludeLimit: includeLimit})
+}
+
+// BucketScan returns every key/value pair in the named bucket within
+// [start, limit), as bounded by includeStart/includeLimit, as of now.
+func (c *Client) BucketScan(bucket, start, limit string, includeStart, includeLimit bool) ([]server.Pair, error) {
+	return c.scan(server.Request{Op: server.OpScan, Bucket: bucket, RangeStart: start, RangeLimit: limit, IncludeStart: includeStart, IncludeLimit: includeLimit})
+}
+
+func (c *Client) scan(req server.Request) ([]server.Pair, error) {
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, fmt.Errorf("client: %s", resp.Err)
+	}
+	return resp.Pairs, nil
+}
@@ -22,15 +22,65 @@ var (
 	ErrTransactionDiscrepancy = errors.New("transaction dicscrepancy")
 )
 
+// version is a single value of an Entry as of a given commit seq.
+type version struct {
+	seq     uint64
+	value   string
+	deleted bool
+}
+
 // Entry represents a database entry.
+//
+// An Entry keeps a short history of its versions, ordered by seq
+// descending (newest first), so that transactions started at an
+// earlier seq can keep reading the value as it was when their
+// snapshot was taken, independently of writes committed afterwards.
 type Entry struct {
-	Value string
+	versions []version
+}
+
+// NewEntry creates a new database entry, recording value as its
+// first version at the provided seq.
+func NewEntry(seq uint64, value string) *Entry {
+	return &Entry{versions: []version{{seq: seq, value: value}}}
+}
+
+// at returns the newest version visible to a reader whose snapshot
+// seq is seq, i.e. the first version (versions are seq-descending)
+// with version.seq <= seq.
+func (e *Entry) at(seq uint64) (version, bool) {
+	for _, v := range e.versions {
+		if v.seq <= seq {
+			return v, true
+		}
+	}
+	return version{}, false
 }
 
-// NewEntry creates a new database entry
-// initialized using the provided value.
-func NewEntry(value string) *Entry {
-	return &Entry{Value: value}
+// latest returns the most recently committed version of the entry,
+// regardless of any snapshot.
+func (e *Entry) latest() (version, bool) {
+	if len(e.versions) == 0 {
+		return version{}, false
+	}
+	return e.versions[0], true
+}
+
+// addVersion records a new version as the newest one.
+func (e *Entry) addVersion(v version) {
+	e.versions = append([]version{v}, e.versions...)
+}
+
+// vacuum drops versions older than minLiveSeq, keeping the newest
+// version that is still visible at minLiveSeq so that transactions
+// with a snapshot seq >= minLiveSeq keep reading consistent data.
+func (e *Entry) vacuum(minLiveSeq uint64) {
+	for i, v := range e.versions {
+		if v.seq <= minLiveSeq {
+			e.versions = e.versions[:i+1]
+			return
+		}
+	}
 }
 
 // Database is an in-memory key-value store.
@@ -42,6 +92,20 @@ type Database struct {
 
 	mu   sync.RWMutex
 	data map[string]*Entry
+	// keys holds every key currently in data, ordered, so range scans
+	// can seek their bounds instead of scanning the whole map.
+	// Callers must hold mu.
+	keys orderedKeys
+	seq  uint64
+
+	// persist is nil for databases created with NewDatabase, and set
+	// for databases opened with OpenDatabase.
+	persist Persistence
+	dir     string
+
+	// buckets holds every namespace created via CreateBucket, keyed
+	// by name. Guarded by mu.
+	buckets map[string]*Bucket
 }
 
 // NewDatabase creates a new Database.
@@ -49,10 +113,18 @@ func NewDatabase() *Database {
 	db := &Database{
 		activeTransactions: make(map[string]*Transaction),
 		data:               make(map[string]*Entry),
+		keys:               newOrderedKeys(),
 	}
 	return db
 }
 
+// nextSeq bumps and returns the database's monotonically-increasing
+// sequence counter. Callers must hold d.mu for writing.
+func (d *Database) nextSeq() uint64 {
+	d.seq++
+	return d.seq
+}
+
 type releaseLock func()
 
 func (d *Database) getTransaction(xid string) (*Transaction, releaseLock, error) {
@@ -77,7 +149,19 @@ func (d *Database) Put(key string, value string) error {
 	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.data[key] = NewEntry(value)
+	seq := d.nextSeq()
+	if err := d.appendWAL(Record{Op: OpPut, Seq: seq, Key: key, Value: value}); err != nil {
+		return err
+	}
+	if err := d.appendWAL(Record{Op: OpCommit, Seq: seq}); err != nil {
+		return err
+	}
+	if entry, ok := d.data[key]; ok {
+		entry.addVersion(version{seq: seq, value: value})
+		return nil
+	}
+	d.data[key] = NewEntry(seq, value)
+	d.keys.insert(key)
 	return nil
 }
 
@@ -103,7 +187,11 @@ func (d *Database) Get(key string) (string, error) {
 	if !ok {
 		return "", ErrKeyNotFound
 	}
-	return entry.Value, nil
+	v, ok := entry.latest()
+	if !ok || v.deleted {
+		return "", ErrKeyNotFound
+	}
+	return v.value, nil
 }
 
 // GetTxn returns the value associated with the provided key
@@ -124,10 +212,22 @@ func (d *Database) Delete(key string) error {
 	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	if _, ok := d.data[key]; !ok {
+	entry, ok := d.data[key]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	v, ok := entry.latest()
+	if !ok || v.deleted {
 		return ErrKeyNotFound
 	}
-	delete(d.data, key)
+	seq := d.nextSeq()
+	if err := d.appendWAL(Record{Op: OpDelete, Seq: seq, Key: key}); err != nil {
+		return err
+	}
+	if err := d.appendWAL(Record{Op: OpCommit, Seq: seq}); err != nil {
+		return err
+	}
+	entry.addVersion(version{seq: seq, deleted: true})
 	return nil
 }
 
@@ -144,7 +244,19 @@ func (d *Database) DeleteTxn(key string, xid string) error {
 
 // CreateTransaction initializes a transaction
 // for the provided transaction ID.
+//
+// The transaction captures the database's current seq as its
+// snapshot, so every read it performs is consistent with the
+// database as it was at the time of this call (snapshot isolation).
+// It is equivalent to CreateTransactionWithOptions(xid, TransactionOptions{}).
 func (d *Database) CreateTransaction(xid string) error {
+	return d.CreateTransactionWithOptions(xid, TransactionOptions{})
+}
+
+// CreateTransactionWithOptions initializes a transaction for the
+// provided transaction ID, as CreateTransaction does, configured
+// according to opts.
+func (d *Database) CreateTransactionWithOptions(xid string, opts TransactionOptions) error {
 	transaction, release, err := d.getTransaction(xid)
 	defer release()
 	if err != nil && err != ErrTransactionNotFound {
@@ -153,7 +265,10 @@ func (d *Database) CreateTransaction(xid string) error {
 	if transaction != nil {
 		return ErrTransactionExists
 	}
-	d.activeTransactions[xid] = NewTransaction(xid, d)
+	d.mu.RLock()
+	seq := d.seq
+	d.mu.RUnlock()
+	d.activeTransactions[xid] = NewTransaction(xid, d, seq, opts)
 	return nil
 }
 
@@ -161,9 +276,9 @@ func (d *Database) CreateTransaction(xid string) error {
 // for the provided transaction ID.
 func (d *Database) RollbackTransaction(xid string) error {
 	defer func() {
-		d.mu.Lock()
+		d.tMu.Lock()
 		delete(d.activeTransactions, xid)
-		d.mu.Unlock()
+		d.tMu.Unlock()
 	}()
 
 	_, release, err := d.getTransaction(xid)
@@ -176,11 +291,18 @@ func (d *Database) RollbackTransaction(xid string) error {
 
 // CommitTransaction applies uncommited changes to the database
 // for the provided transaction ID.
+//
+// A write-write conflict is detected whenever a key written by the
+// transaction has a version newer than the transaction's snapshot
+// seq, meaning it was committed by someone else after the
+// transaction started. If the transaction was created with
+// TransactionOptions.TrackReads, a read-write conflict is also detected for keys
+// the transaction only read: see Transaction's readSeq field.
 func (d *Database) CommitTransaction(xid string) error {
 	defer func() {
-		d.mu.Lock()
+		d.tMu.Lock()
 		delete(d.activeTransactions, xid)
-		d.mu.Unlock()
+		d.tMu.Unlock()
 	}()
 
 	transaction, release, err := d.getTransaction(xid)
@@ -193,28 +315,132 @@ func (d *Database) CommitTransaction(xid string) error {
 	// against current state of database.
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	for key, uEntry := range transaction.uncommitedData {
+	for key := range transaction.uncommitedData {
 		entry, ok := d.data[key]
-		if !ok && uEntry.state != stateAdded {
+		if !ok {
+			continue
+		}
+		if v, ok := entry.latest(); ok && v.seq > transaction.seq {
 			return ErrTransactionDiscrepancy
 		}
-		if ok {
-			if uEntry.state == stateAdded {
-				return ErrTransactionDiscrepancy
+	}
+	buckets := make(map[string]*Bucket, len(transaction.bucketWrites))
+	for name, writes := range transaction.bucketWrites {
+		b, ok := d.buckets[name]
+		if !ok {
+			return ErrBucketNotFound
+		}
+		buckets[name] = b
+		b.mu.RLock()
+		for key := range writes {
+			entry, ok := b.data[key]
+			if ok {
+				if v, ok := entry.latest(); ok && v.seq > transaction.seq {
+					b.mu.RUnlock()
+					return ErrTransactionDiscrepancy
+				}
 			}
-			if uEntry.oldValue != &entry.Value {
+		}
+		b.mu.RUnlock()
+	}
+	if transaction.opts.TrackReads {
+		for key, seq := range transaction.readSeq {
+			entry, ok := d.data[key]
+			if !ok {
+				if seq != 0 {
+					// the key had a version when read, but its entry
+					// is gone entirely now, which Vacuum never does
+					// for a live key.
+					return ErrTransactionDiscrepancy
+				}
+				continue
+			}
+			v, ok := entry.latest()
+			if !ok || (seq == 0) != v.deleted || (seq != 0 && v.seq != seq) {
 				return ErrTransactionDiscrepancy
 			}
 		}
 	}
-	// no discrepancies, update database.
+	// no discrepancies, update database using a single commit seq.
+	commitSeq := d.nextSeq()
 	for key, uEntry := range transaction.uncommitedData {
+		var rec Record
 		switch uEntry.state {
 		case stateAdded, stateUpdated:
-			d.data[key] = NewEntry(*uEntry.newValue)
+			rec = Record{Op: OpPut, Seq: commitSeq, Key: key, Value: *uEntry.newValue}
 		case stateDeleted:
-			delete(d.data, key)
+			rec = Record{Op: OpDelete, Seq: commitSeq, Key: key}
 		}
+		if err := d.appendWAL(rec); err != nil {
+			return err
+		}
+	}
+	// the trailing OpCommit marks every record written above as part
+	// of the same atomic unit: on replay, they are only applied once
+	// this marker is reached, so a crash mid-commit leaves them
+	// discarded instead of partially applied.
+	if err := d.appendWAL(Record{Op: OpCommit, Seq: commitSeq}); err != nil {
+		return err
+	}
+	for key, uEntry := range transaction.uncommitedData {
+		switch uEntry.state {
+		case stateAdded, stateUpdated:
+			if entry, ok := d.data[key]; ok {
+				entry.addVersion(version{seq: commitSeq, value: *uEntry.newValue})
+			} else {
+				d.data[key] = NewEntry(commitSeq, *uEntry.newValue)
+				d.keys.insert(key)
+			}
+		case stateDeleted:
+			if entry, ok := d.data[key]; ok {
+				entry.addVersion(version{seq: commitSeq, deleted: true})
+			}
+		}
+	}
+	// bucket writes share the same commit seq so that reads through
+	// either the default space or a bucket observe a consistent
+	// snapshot. There is no WAL record to append here: buckets only
+	// exist on a Database created via NewDatabase, since CreateBucket
+	// refuses to run on one opened with OpenDatabase (see
+	// ErrBucketNotDurable).
+	for name, writes := range transaction.bucketWrites {
+		b := buckets[name]
+		b.mu.Lock()
+		for key, uEntry := range writes {
+			switch uEntry.state {
+			case stateAdded, stateUpdated:
+				if entry, ok := b.data[key]; ok {
+					entry.addVersion(version{seq: commitSeq, value: *uEntry.newValue})
+				} else {
+					b.data[key] = NewEntry(commitSeq, *uEntry.newValue)
+					b.keys.insert(key)
+				}
+			case stateDeleted:
+				if entry, ok := b.data[key]; ok {
+					entry.addVersion(version{seq: commitSeq, deleted: true})
+				}
+			}
+		}
+		b.mu.Unlock()
 	}
 	return nil
 }
+
+// Vacuum trims version history older than minLiveSeq, which callers
+// should set to the snapshot seq of the oldest still-active
+// transaction (or the database's current seq if none are active).
+// Versions still needed to satisfy that transaction's reads are
+// preserved.
+func (d *Database) Vacuum(minLiveSeq uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, entry := range d.data {
+		entry.vacuum(minLiveSeq)
+		if v, ok := entry.latest(); ok && len(entry.versions) == 1 && v.deleted {
+			// nothing older than minLiveSeq can still observe this
+			// tombstone, so the key can be forgotten entirely.
+			delete(d.data, key)
+			d.keys.remove(key)
+		}
+	}
+}
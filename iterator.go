@@ -0,0 +1,162 @@
+package inmemdb
+
+import "sort"
+
+// Range describes the bounds of a range scan over a Database or
+// Transaction. An empty Start/Limit means unbounded on that side.
+type Range struct {
+	Start        string
+	Limit        string
+	IncludeStart bool
+	IncludeLimit bool
+}
+
+// prefixRange builds the Range matching every key starting with
+// prefix.
+func prefixRange(prefix string) Range {
+	rng := Range{Start: prefix, IncludeStart: true}
+	if prefix == "" {
+		return rng
+	}
+	limit := []byte(prefix)
+	i := len(limit) - 1
+	for i >= 0 && limit[i] == 0xff {
+		i--
+	}
+	if i < 0 {
+		// prefix is all 0xff bytes, there is no finite upper bound.
+		return rng
+	}
+	limit = limit[:i+1]
+	limit[i]++
+	rng.Limit = string(limit)
+	return rng
+}
+
+// Iterator walks a range of keys in sorted order. It holds a
+// consistent read snapshot taken at the time it was created, so
+// concurrent writers cannot corrupt an in-progress scan. An Iterator
+// must be positioned with Next before the first call to Key/Value,
+// following the same convention as bufio.Scanner.
+type Iterator interface {
+	Next() bool
+	Key() string
+	Value() string
+	Err() error
+	Close() error
+}
+
+type keyValue struct {
+	key   string
+	value string
+}
+
+// sliceIterator is an Iterator over an already-materialized,
+// sorted snapshot of key/value pairs.
+type sliceIterator struct {
+	pairs []keyValue
+	idx   int
+}
+
+func newSliceIterator(pairs []keyValue) *sliceIterator {
+	return &sliceIterator{pairs: pairs, idx: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	it.idx++
+	return it.idx < len(it.pairs)
+}
+
+func (it *sliceIterator) Key() string { return it.pairs[it.idx].key }
+
+func (it *sliceIterator) Value() string { return it.pairs[it.idx].value }
+
+func (it *sliceIterator) Err() error { return nil }
+
+func (it *sliceIterator) Close() error { return nil }
+
+// snapshotRange materializes the key/value pairs visible at seq
+// within rng, out of data/keys. Callers must hold the lock guarding
+// data/keys.
+func snapshotRange(data map[string]*Entry, keys orderedKeys, seq uint64, rng Range) []keyValue {
+	var pairs []keyValue
+	keys.ascendRange(rng, func(key string) bool {
+		rec, ok := data[key].at(seq)
+		if ok && !rec.deleted {
+			pairs = append(pairs, keyValue{key: key, value: rec.value})
+		}
+		return true
+	})
+	return pairs
+}
+
+// NewIterator returns an Iterator over the committed keys in rng, as
+// of now.
+func (d *Database) NewIterator(rng Range) Iterator {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return newSliceIterator(snapshotRange(d.data, d.keys, d.seq, rng))
+}
+
+// NewPrefixIterator returns an Iterator over every committed key
+// starting with prefix, as of now.
+func (d *Database) NewPrefixIterator(prefix string) Iterator {
+	return d.NewIterator(prefixRange(prefix))
+}
+
+// NewIterator returns an Iterator over the keys in rng, merging the
+// transaction's snapshot of the database with its own uncommitted
+// writes.
+func (t *Transaction) NewIterator(rng Range) Iterator {
+	t.db.mu.RLock()
+	pairs := snapshotRange(t.db.data, t.db.keys, t.seq, rng)
+	t.db.mu.RUnlock()
+
+	merged := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		merged[p.key] = p.value
+	}
+	for key, uEntry := range t.uncommitedData {
+		if !inRange(key, rng) {
+			continue
+		}
+		if uEntry.state == stateDeleted {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = *uEntry.newValue
+	}
+
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]keyValue, len(keys))
+	for i, key := range keys {
+		out[i] = keyValue{key: key, value: merged[key]}
+	}
+	return newSliceIterator(out)
+}
+
+// NewPrefixIterator returns an Iterator over every key starting with
+// prefix, merging the transaction's snapshot of the database with
+// its own uncommitted writes.
+func (t *Transaction) NewPrefixIterator(prefix string) Iterator {
+	return t.NewIterator(prefixRange(prefix))
+}
+
+func inRange(key string, rng Range) bool {
+	if rng.Start != "" {
+		if key < rng.Start || (key == rng.Start && !rng.IncludeStart) {
+			return false
+		}
+	}
+	if rng.Limit != "" {
+		if key > rng.Limit || (key == rng.Limit && !rng.IncludeLimit) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package inmemdb
+
+import "testing"
+
+func collect(it Iterator) []keyValue {
+	var got []keyValue
+	for it.Next() {
+		got = append(got, keyValue{key: it.Key(), value: it.Value()})
+	}
+	return got
+}
+
+func TestDatabaseNewIterator(t *testing.T) {
+	db := stubDatabase(t)
+	for _, kv := range []keyValue{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}} {
+		if err := db.Put(kv.key, kv.value); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("got error on Delete but should have got nil: %v", err)
+	}
+
+	got := collect(db.NewIterator(Range{Start: "a", Limit: "d", IncludeStart: true, IncludeLimit: false}))
+	want := []keyValue{{"a", "1"}, {"c", "3"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pairs, but wanted %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got pair %d: %v, but wanted: %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDatabaseNewPrefixIterator(t *testing.T) {
+	db := stubDatabase(t)
+	for _, kv := range []keyValue{{"user:1", "a"}, {"user:2", "b"}, {"order:1", "c"}} {
+		if err := db.Put(kv.key, kv.value); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+	}
+
+	got := collect(db.NewPrefixIterator("user:"))
+	if len(got) != 2 {
+		t.Fatalf("got %d pairs, but wanted 2: %v", len(got), got)
+	}
+	if got[0].key != "user:1" || got[1].key != "user:2" {
+		t.Errorf("got keys: %v, %v, but wanted: user:1, user:2", got[0].key, got[1].key)
+	}
+}
+
+func TestTransactionNewIterator(t *testing.T) {
+	db := stubDatabase(t)
+	if err := db.Put("a", "1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Put("b", "2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+
+	if err := db.CreateTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+	}
+	if err := db.PutTxn("c", "3", "tx1"); err != nil {
+		t.Fatalf("got error on PutTxn but should have got nil: %v", err)
+	}
+	if err := db.DeleteTxn("a", "tx1"); err != nil {
+		t.Fatalf("got error on DeleteTxn but should have got nil: %v", err)
+	}
+
+	tx, err := db.Transaction("tx1")
+	if err != nil {
+		t.Fatalf("got error on Transaction but should have got nil: %v", err)
+	}
+
+	got := collect(tx.NewIterator(Range{}))
+	want := []keyValue{{"b", "2"}, {"c", "3"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pairs, but wanted %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got pair %d: %v, but wanted: %v", i, got[i], want[i])
+		}
+	}
+
+	// uncommitted writes must not be visible outside the transaction.
+	dbGot := collect(db.NewIterator(Range{}))
+	dbWant := []keyValue{{"a", "1"}, {"b", "2"}}
+	if len(dbGot) != len(dbWant) {
+		t.Fatalf("got %d pairs, but wanted %d: %v", len(dbGot), len(dbWant), dbGot)
+	}
+}
@@ -0,0 +1,54 @@
+package inmemdb
+
+import "github.com/google/btree"
+
+// btreeDegree is the branching factor used for every ordered key
+// index in the package. 32 matches the degree google/btree's own
+// benchmarks settle on as a good default for string-sized items.
+const btreeDegree = 32
+
+// orderedKeys is an ordered set of keys backed by a B-tree, giving
+// the inserts/removes/range-scans it supports logarithmic cost
+// instead of the linear slice shifting a plain sorted []string
+// requires. It does no locking of its own: callers
+// must hold whatever mutex guards the Database/Bucket it belongs to.
+type orderedKeys struct {
+	t *btree.BTreeG[string]
+}
+
+// newOrderedKeys returns an empty orderedKeys, ready to use.
+func newOrderedKeys() orderedKeys {
+	return orderedKeys{t: btree.NewG(btreeDegree, func(a, b string) bool { return a < b })}
+}
+
+// insert records key in the set if it isn't already there.
+func (k orderedKeys) insert(key string) {
+	k.t.ReplaceOrInsert(key)
+}
+
+// remove drops key from the set.
+func (k orderedKeys) remove(key string) {
+	k.t.Delete(key)
+}
+
+// ascend calls fn for every key in the set, in ascending order,
+// stopping early if fn returns false.
+func (k orderedKeys) ascend(fn func(key string) bool) {
+	k.t.Ascend(fn)
+}
+
+// ascendRange calls fn for every key matching rng, in ascending
+// order, stopping early if fn returns false.
+func (k orderedKeys) ascendRange(rng Range, fn func(key string) bool) {
+	k.t.AscendGreaterOrEqual(rng.Start, func(key string) bool {
+		if key == rng.Start && !rng.IncludeStart {
+			return true
+		}
+		if rng.Limit != "" {
+			if key > rng.Limit || (key == rng.Limit && !rng.IncludeLimit) {
+				return false
+			}
+		}
+		return fn(key)
+	})
+}
@@ -0,0 +1,465 @@
+package inmemdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// OpCode identifies the kind of change a Record represents.
+type OpCode byte
+
+// Op enum.
+const (
+	OpPut OpCode = iota
+	OpDelete
+	// OpCommit marks the end of a transaction's writes. Records
+	// written after the last OpCommit in the log are considered
+	// partial and are discarded on replay.
+	OpCommit
+)
+
+// Record is a single entry of the write-ahead log.
+type Record struct {
+	Op    OpCode
+	Seq   uint64
+	Key   string
+	Value string
+}
+
+// Persistence durably records every Record a Database applies, so
+// the database can be rebuilt after a restart. Implementations must
+// be safe for concurrent use.
+type Persistence interface {
+	// Append durably records rec according to the implementation's
+	// sync policy.
+	Append(rec Record) error
+	// Replay calls apply, in log order, for every Record previously
+	// written via Append (across process restarts). Records belonging
+	// to a transaction that never reached an OpCommit are skipped.
+	Replay(apply func(Record) error) error
+	// Truncate discards every record written so far, typically called
+	// right after a Checkpoint snapshot makes them redundant.
+	Truncate() error
+	// Close releases any resource held by the implementation.
+	Close() error
+}
+
+type syncMode int
+
+const (
+	syncAlways syncMode = iota
+	syncInterval
+	syncNever
+)
+
+// SyncPolicy controls how aggressively a file-backed Persistence
+// flushes writes to stable storage.
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+}
+
+// SyncAlways fsyncs after every Append. It is the slowest and safest
+// policy, and the default used by OpenDatabase.
+func SyncAlways() SyncPolicy { return SyncPolicy{mode: syncAlways} }
+
+// SyncInterval fsyncs at most once every d, batching writes in
+// between. A process crash can lose up to d worth of appends.
+func SyncInterval(d time.Duration) SyncPolicy {
+	return SyncPolicy{mode: syncInterval, interval: d}
+}
+
+// SyncNever never fsyncs explicitly, relying on the OS to flush the
+// buffered writer's underlying file eventually. Fastest, least safe.
+func SyncNever() SyncPolicy { return SyncPolicy{mode: syncNever} }
+
+// fileWAL is the default, file-backed Persistence implementation.
+type fileWAL struct {
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	policy SyncPolicy
+	dirty  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFileWAL(path string, policy SyncPolicy) (*fileWAL, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("inmemdb: open wal: %w", err)
+	}
+	wal := &fileWAL{
+		file:   f,
+		w:      bufio.NewWriter(f),
+		policy: policy,
+	}
+	if policy.mode == syncInterval {
+		wal.stop = make(chan struct{})
+		wal.done = make(chan struct{})
+		go wal.syncLoop()
+	}
+	return wal, nil
+}
+
+func (w *fileWAL) syncLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.policy.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.dirty {
+				_ = w.w.Flush()
+				_ = w.file.Sync()
+				w.dirty = false
+			}
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// encodeRecord writes rec in the wire format: 1 byte op, 8 byte
+// big-endian seq, 4 byte key length, key, 4 byte value length, value.
+func encodeRecord(w io.Writer, rec Record) error {
+	var header [13]byte
+	header[0] = byte(rec.Op)
+	binary.BigEndian.PutUint64(header[1:9], rec.Seq)
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(rec.Key)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, rec.Key); err != nil {
+		return err
+	}
+	var valLen [4]byte
+	binary.BigEndian.PutUint32(valLen[:], uint32(len(rec.Value)))
+	if _, err := w.Write(valLen[:]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, rec.Value)
+	return err
+}
+
+func decodeRecord(r io.Reader) (Record, error) {
+	var header [13]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Record{}, err
+	}
+	rec := Record{
+		Op:  OpCode(header[0]),
+		Seq: binary.BigEndian.Uint64(header[1:9]),
+	}
+	keyLen := binary.BigEndian.Uint32(header[9:13])
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return Record{}, err
+	}
+	rec.Key = string(key)
+
+	var valLen [4]byte
+	if _, err := io.ReadFull(r, valLen[:]); err != nil {
+		return Record{}, err
+	}
+	value := make([]byte, binary.BigEndian.Uint32(valLen[:]))
+	if _, err := io.ReadFull(r, value); err != nil {
+		return Record{}, err
+	}
+	rec.Value = string(value)
+	return rec, nil
+}
+
+func (w *fileWAL) Append(rec Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := encodeRecord(w.w, rec); err != nil {
+		return err
+	}
+	switch w.policy.mode {
+	case syncAlways:
+		if err := w.w.Flush(); err != nil {
+			return err
+		}
+		return w.file.Sync()
+	case syncNever:
+		return w.w.Flush()
+	default: // syncInterval
+		w.dirty = true
+		return nil
+	}
+}
+
+// Replay reads every record written so far, in order, buffering
+// records between commit markers so that a transaction whose writes
+// were cut short by a crash (no trailing OpCommit) is dropped
+// entirely.
+func (w *fileWAL) Replay(apply func(Record) error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(w.file)
+
+	// offset is how far into the file decoding has got, committed the
+	// offset just past the last OpCommit read.
+	var pending []Record
+	var offset, committed int64
+	for {
+		rec, err := decodeRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a record cut short by a crash ends the log.
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("inmemdb: replay wal: %w", err)
+		}
+		offset += int64(17 + len(rec.Key) + len(rec.Value))
+		switch rec.Op {
+		case OpCommit:
+			for _, buffered := range pending {
+				if err := apply(buffered); err != nil {
+					return err
+				}
+			}
+			pending = nil
+			committed = offset
+		default:
+			pending = append(pending, rec)
+		}
+	}
+	// pending left over without a trailing OpCommit is a partial
+	// write, discarded on purpose: it is cut off the log so that a
+	// later OpCommit cannot pick it up.
+	if err := w.file.Truncate(committed); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *fileWAL) Truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.w.Reset(w.file)
+	return nil
+}
+
+func (w *fileWAL) Close() error {
+	if w.stop != nil {
+		close(w.stop)
+		<-w.done
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// Options configures OpenDatabase.
+type Options struct {
+	// Persistence overrides the default file-backed WAL. Left nil, a
+	// fileWAL using SyncPolicy is created inside dir.
+	Persistence Persistence
+	// SyncPolicy controls the default file-backed WAL's fsync
+	// behavior. Ignored if Persistence is set.
+	SyncPolicy SyncPolicy
+}
+
+const (
+	walFileName      = "inmemdb.wal"
+	snapshotFileName = "inmemdb.snapshot"
+)
+
+// appendWAL is a no-op when the database has no configured
+// Persistence, so callers don't need to special-case it.
+func (d *Database) appendWAL(rec Record) error {
+	if d.persist == nil {
+		return nil
+	}
+	return d.persist.Append(rec)
+}
+
+// OpenDatabase opens (creating if necessary) a durable Database
+// rooted at dir, replaying its snapshot and write-ahead log.
+func OpenDatabase(dir string, opts Options) (*Database, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("inmemdb: open database: %w", err)
+	}
+
+	db := NewDatabase()
+	if err := db.loadSnapshot(filepath.Join(dir, snapshotFileName)); err != nil {
+		return nil, err
+	}
+
+	persist := opts.Persistence
+	if persist == nil {
+		policy := opts.SyncPolicy
+		if policy == (SyncPolicy{}) {
+			policy = SyncAlways()
+		}
+		wal, err := newFileWAL(filepath.Join(dir, walFileName), policy)
+		if err != nil {
+			return nil, err
+		}
+		persist = wal
+	}
+
+	if err := persist.Replay(func(rec Record) error {
+		db.applyRecord(rec)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	db.persist = persist
+	db.dir = dir
+	return db, nil
+}
+
+// applyRecord replays a single WAL record directly into the map,
+// bypassing Put/Delete (and their own WAL appends) since the record
+// is already durable.
+func (d *Database) applyRecord(rec Record) {
+	if rec.Seq > d.seq {
+		d.seq = rec.Seq
+	}
+	switch rec.Op {
+	case OpPut:
+		if entry, ok := d.data[rec.Key]; ok {
+			entry.addVersion(version{seq: rec.Seq, value: rec.Value})
+			return
+		}
+		d.data[rec.Key] = NewEntry(rec.Seq, rec.Value)
+		d.keys.insert(rec.Key)
+	case OpDelete:
+		if entry, ok := d.data[rec.Key]; ok {
+			entry.addVersion(version{seq: rec.Seq, deleted: true})
+		}
+	}
+}
+
+// Checkpoint writes a compact snapshot of the database's current
+// committed state to its snapshot file, then truncates the
+// write-ahead log since its history is now redundant. It only
+// applies to a Database opened via OpenDatabase, since that's the
+// only case where OpenDatabase knows where to read the snapshot back
+// from on the next restart.
+func (d *Database) Checkpoint() error {
+	if d.dir == "" {
+		return fmt.Errorf("inmemdb: checkpoint: database has no directory, was it opened with OpenDatabase?")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.buckets) > 0 {
+		return fmt.Errorf("inmemdb: checkpoint: %w", ErrBucketNotDurable)
+	}
+
+	f, err := os.Create(filepath.Join(d.dir, snapshotFileName))
+	if err != nil {
+		return fmt.Errorf("inmemdb: checkpoint: %w", err)
+	}
+	w := bufio.NewWriter(f)
+
+	var seqHeader [8]byte
+	binary.BigEndian.PutUint64(seqHeader[:], d.seq)
+	if _, err := w.Write(seqHeader[:]); err != nil {
+		f.Close()
+		return err
+	}
+	var encodeErr error
+	d.keys.ascend(func(key string) bool {
+		v, ok := d.data[key].latest()
+		if !ok || v.deleted {
+			return true
+		}
+		encodeErr = encodeRecord(w, Record{Op: OpPut, Seq: v.seq, Key: key, Value: v.value})
+		return encodeErr == nil
+	})
+	if encodeErr != nil {
+		f.Close()
+		return encodeErr
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if d.persist != nil {
+		return d.persist.Truncate()
+	}
+	return nil
+}
+
+func (d *Database) loadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("inmemdb: load snapshot: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var seqHeader [8]byte
+	if _, err := io.ReadFull(r, seqHeader[:]); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("inmemdb: load snapshot: %w", err)
+	}
+	d.seq = binary.BigEndian.Uint64(seqHeader[:])
+
+	for {
+		rec, err := decodeRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("inmemdb: load snapshot: %w", err)
+		}
+		d.data[rec.Key] = NewEntry(rec.Seq, rec.Value)
+		d.keys.insert(rec.Key)
+	}
+}
+
+// Close releases the Persistence backing a Database opened via
+// OpenDatabase. It is a no-op for databases created with
+// NewDatabase.
+func (d *Database) Close() error {
+	if d.persist == nil {
+		return nil
+	}
+	return d.persist.Close()
+}
@@ -0,0 +1,92 @@
+package inmemdb
+
+import "testing"
+
+func TestOpenDatabaseReplaysWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := OpenDatabase(dir, Options{})
+	if err != nil {
+		t.Fatalf("got error on OpenDatabase but should have got nil: %v", err)
+	}
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Put("key2", "value2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Delete("key1"); err != nil {
+		t.Fatalf("got error on Delete but should have got nil: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("got error on Close but should have got nil: %v", err)
+	}
+
+	reopened, err := OpenDatabase(dir, Options{})
+	if err != nil {
+		t.Fatalf("got error on OpenDatabase but should have got nil: %v", err)
+	}
+	defer reopened.Close()
+
+	if _, err := reopened.Get("key1"); err != ErrKeyNotFound {
+		t.Errorf("got error: %v, but wanted: %v", err, ErrKeyNotFound)
+	}
+	value, err := reopened.Get("key2")
+	if err != nil {
+		t.Errorf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value2")
+	}
+}
+
+func TestDatabaseCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := OpenDatabase(dir, Options{})
+	if err != nil {
+		t.Fatalf("got error on OpenDatabase but should have got nil: %v", err)
+	}
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Checkpoint(); err != nil {
+		t.Fatalf("got error on Checkpoint but should have got nil: %v", err)
+	}
+	if err := db.Put("key2", "value2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("got error on Close but should have got nil: %v", err)
+	}
+
+	reopened, err := OpenDatabase(dir, Options{})
+	if err != nil {
+		t.Fatalf("got error on OpenDatabase but should have got nil: %v", err)
+	}
+	defer reopened.Close()
+
+	for key, want := range map[string]string{"key1": "value1", "key2": "value2"} {
+		got, err := reopened.Get(key)
+		if err != nil {
+			t.Errorf("got error on Get(%v) but should have got nil: %v", key, err)
+		}
+		if got != want {
+			t.Errorf("got value: %v, but wanted: %v", got, want)
+		}
+	}
+}
+
+func TestCreateBucketOnDurableDatabaseFails(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := OpenDatabase(dir, Options{})
+	if err != nil {
+		t.Fatalf("got error on OpenDatabase but should have got nil: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.CreateBucket("users"); err != ErrBucketNotDurable {
+		t.Errorf("got error: %v, but wanted: %v", err, ErrBucketNotDurable)
+	}
+}
@@ -0,0 +1,118 @@
+package inmemdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// IsRetryable reports whether err is a transient error that a caller
+// of RunInTransaction should retry the transaction for, such as a
+// write-write conflict detected at commit time.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrTransactionDiscrepancy)
+}
+
+// RetryOption configures the retry behavior of RunInTransaction.
+type RetryOption func(*retryConfig)
+
+type retryConfig struct {
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+func defaultRetryConfig() retryConfig {
+	return retryConfig{
+		maxAttempts: 5,
+		baseDelay:   10 * time.Millisecond,
+	}
+}
+
+// WithMaxAttempts overrides the maximum number of attempts
+// RunInTransaction will make before giving up. The default is 5.
+func WithMaxAttempts(n int) RetryOption {
+	return func(c *retryConfig) { c.maxAttempts = n }
+}
+
+// WithBaseDelay overrides the initial delay used for the exponential
+// backoff between retries. The default is 10ms.
+func WithBaseDelay(d time.Duration) RetryOption {
+	return func(c *retryConfig) { c.baseDelay = d }
+}
+
+var txnCounter uint64
+
+// newTransactionID generates a transaction ID unique to this
+// Database instance, for use by callers that don't need to manage
+// xids themselves.
+func (d *Database) newTransactionID() string {
+	return fmt.Sprintf("auto-%d", atomic.AddUint64(&txnCounter, 1))
+}
+
+// Transaction returns the currently active transaction associated
+// with xid.
+func (d *Database) Transaction(xid string) (*Transaction, error) {
+	transaction, release, err := d.getTransaction(xid)
+	defer release()
+	return transaction, err
+}
+
+// RunInTransaction runs fn against a fresh Transaction, committing
+// on success and rolling back if fn returns an error. If the commit
+// fails with a retryable error (see IsRetryable), the transaction is
+// retried with exponential backoff until it succeeds, a non-retryable
+// error occurs, ctx is done, or the configured max attempts is
+// reached.
+//
+// Unlike PutTxn/GetTxn/DeleteTxn, fn is handed the *Transaction
+// directly so it can call tx.Put/tx.Get/tx.Delete without going
+// through the xid-string API, which remains available for
+// wire-protocol callers that can't hold a Go value across requests.
+func (d *Database) RunInTransaction(ctx context.Context, fn func(tx *Transaction) error, opts ...RetryOption) error {
+	cfg := defaultRetryConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var lastErr error
+	delay := cfg.baseDelay
+	for attempt := 0; attempt < cfg.maxAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		xid := d.newTransactionID()
+		if err := d.CreateTransaction(xid); err != nil {
+			return err
+		}
+
+		tx, err := d.Transaction(xid)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(tx); err != nil {
+			_ = d.RollbackTransaction(xid)
+			return err
+		}
+
+		err = d.CommitTransaction(xid)
+		if err == nil {
+			return nil
+		}
+		if !IsRetryable(err) {
+			return err
+		}
+		lastErr = err
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return fmt.Errorf("inmemdb: giving up after %d attempts: %w", cfg.maxAttempts, lastErr)
+}
@@ -0,0 +1,80 @@
+package inmemdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunInTransactionCommits(t *testing.T) {
+	db := stubDatabase(t)
+
+	err := db.RunInTransaction(context.Background(), func(tx *Transaction) error {
+		return tx.Put("key1", "value1")
+	})
+	if err != nil {
+		t.Errorf("got error on RunInTransaction but should have got nil: %v", err)
+	}
+
+	value, err := db.Get("key1")
+	if err != nil {
+		t.Errorf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+}
+
+func TestRunInTransactionRollsBackOnFnError(t *testing.T) {
+	db := stubDatabase(t)
+	wantErr := errors.New("boom")
+
+	err := db.RunInTransaction(context.Background(), func(tx *Transaction) error {
+		if err := tx.Put("key1", "value1"); err != nil {
+			return err
+		}
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("got error: %v, but wanted: %v", err, wantErr)
+	}
+
+	_, err = db.Get("key1")
+	if err != ErrKeyNotFound {
+		t.Errorf("got error: %v, but wanted: %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestRunInTransactionRetriesOnConflict(t *testing.T) {
+	db := stubDatabase(t)
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+
+	attempts := 0
+	err := db.RunInTransaction(context.Background(), func(tx *Transaction) error {
+		attempts++
+		// force a write-write conflict on the first attempt only, by
+		// committing a concurrent change to the same key behind tx's back.
+		if attempts == 1 {
+			if err := db.Put("key1", "concurrent"); err != nil {
+				t.Fatalf("got error on Put but should have got nil: %v", err)
+			}
+		}
+		return tx.Put("key1", "value2")
+	}, WithMaxAttempts(3), WithBaseDelay(0))
+	if err != nil {
+		t.Errorf("got error on RunInTransaction but should have got nil: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, but wanted 2", attempts)
+	}
+
+	value, err := db.Get("key1")
+	if err != nil {
+		t.Errorf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value2")
+	}
+}
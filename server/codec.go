@@ -0,0 +1,348 @@
+// Package server exposes an inmemdb.Database over a TCP protocol,
+// behind a pluggable wire codec.
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Op identifies the operation a Request performs. It mirrors the
+// Database/Transaction method of the same name.
+type Op string
+
+// Supported ops.
+const (
+	OpGet       Op = "GET"
+	OpPut       Op = "PUT"
+	OpDelete    Op = "DELETE"
+	OpBegin     Op = "BEGIN"
+	OpCommit    Op = "COMMIT"
+	OpRollback  Op = "ROLLBACK"
+	OpGetTxn    Op = "GETTXN"
+	OpPutTxn    Op = "PUTTXN"
+	OpDeleteTxn Op = "DELETETXN"
+
+	// OpCreateBucket and OpScan, and the Bucket/range fields they and
+	// the ops above rely on, are only supported over BinaryCodec; see
+	// TextCodec's doc comment.
+	OpCreateBucket Op = "CREATEBUCKET"
+	OpScan         Op = "SCAN"
+)
+
+// Request is a single operation sent from a client to a Server.
+type Request struct {
+	// ID identifies the request so a client can match it to its
+	// Response when pipelining several requests over one connection.
+	// The text codec doesn't carry it (it processes one request at a
+	// time) and always reports it as 0.
+	ID    uint64
+	Op    Op
+	Key   string
+	Value string
+	Xid   string
+
+	// Bucket scopes Get/Put/Delete/*Txn/Scan/CreateBucket to a named
+	// inmemdb.Bucket instead of the database's default key space. The
+	// empty string means the default key space.
+	Bucket string
+
+	// RangeStart, RangeLimit, IncludeStart and IncludeLimit describe
+	// the inmemdb.Range scanned by OpScan.
+	RangeStart   string
+	RangeLimit   string
+	IncludeStart bool
+	IncludeLimit bool
+}
+
+// Pair is a single key/value result of an OpScan.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// Response is a Server's reply to a Request.
+type Response struct {
+	ID    uint64
+	Value string
+	// Err is the empty string on success.
+	Err string
+	// Pairs holds the results of an OpScan.
+	Pairs []Pair
+}
+
+// Codec reads Requests and writes Responses on the server side, and
+// writes Requests and reads Responses on the client side.
+type Codec interface {
+	ReadRequest(r *bufio.Reader) (Request, error)
+	WriteRequest(w io.Writer, req Request) error
+	ReadResponse(r *bufio.Reader) (Response, error)
+	WriteResponse(w io.Writer, resp Response) error
+}
+
+// TextCodec is a line-oriented, human-readable codec suitable for
+// scripting or driving a server by hand over telnet:
+//
+//	GET key\r\n
+//	PUT key value\r\n
+//	BEGIN xid\r\n
+//	COMMIT xid\r\n
+//
+// It processes one request at a time and does not support
+// pipelining, and, being a fixed positional format, does not cover
+// bucket-scoped operations or range scans (OpCreateBucket, OpScan,
+// and the Bucket field on the other ops) — use BinaryCodec for those.
+type TextCodec struct{}
+
+func (TextCodec) ReadRequest(r *bufio.Reader) (Request, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return Request{}, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Request{}, fmt.Errorf("server: empty request")
+	}
+	req := Request{Op: Op(strings.ToUpper(fields[0]))}
+	args := fields[1:]
+	switch req.Op {
+	case OpGet, OpDelete:
+		if len(args) != 1 {
+			return Request{}, fmt.Errorf("server: %s requires a key", req.Op)
+		}
+		req.Key = args[0]
+	case OpPut:
+		if len(args) != 2 {
+			return Request{}, fmt.Errorf("server: %s requires a key and a value", req.Op)
+		}
+		req.Key, req.Value = args[0], args[1]
+	case OpBegin, OpCommit, OpRollback:
+		if len(args) != 1 {
+			return Request{}, fmt.Errorf("server: %s requires a transaction id", req.Op)
+		}
+		req.Xid = args[0]
+	case OpGetTxn, OpDeleteTxn:
+		if len(args) != 2 {
+			return Request{}, fmt.Errorf("server: %s requires a key and a transaction id", req.Op)
+		}
+		req.Key, req.Xid = args[0], args[1]
+	case OpPutTxn:
+		if len(args) != 3 {
+			return Request{}, fmt.Errorf("server: %s requires a key, a value and a transaction id", req.Op)
+		}
+		req.Key, req.Value, req.Xid = args[0], args[1], args[2]
+	case OpCreateBucket, OpScan:
+		return Request{}, fmt.Errorf("server: %s is not supported over the text codec; use BinaryCodec", req.Op)
+	default:
+		return Request{}, fmt.Errorf("server: unknown op %q", fields[0])
+	}
+	return req, nil
+}
+
+func (TextCodec) WriteRequest(w io.Writer, req Request) error {
+	var parts []string
+	switch req.Op {
+	case OpGet, OpDelete:
+		parts = []string{string(req.Op), req.Key}
+	case OpPut:
+		parts = []string{string(req.Op), req.Key, req.Value}
+	case OpBegin, OpCommit, OpRollback:
+		parts = []string{string(req.Op), req.Xid}
+	case OpGetTxn, OpDeleteTxn:
+		parts = []string{string(req.Op), req.Key, req.Xid}
+	case OpPutTxn:
+		parts = []string{string(req.Op), req.Key, req.Value, req.Xid}
+	case OpCreateBucket, OpScan:
+		return fmt.Errorf("server: %s is not supported over the text codec; use BinaryCodec", req.Op)
+	default:
+		return fmt.Errorf("server: unknown op %q", req.Op)
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", strings.Join(parts, " "))
+	return err
+}
+
+func (TextCodec) WriteResponse(w io.Writer, resp Response) error {
+	if resp.Err != "" {
+		_, err := fmt.Fprintf(w, "ERR %s\r\n", resp.Err)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "OK %s\r\n", resp.Value)
+	return err
+}
+
+func (TextCodec) ReadResponse(r *bufio.Reader) (Response, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return Response{}, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "ERR ") {
+		return Response{Err: strings.TrimPrefix(line, "ERR ")}, nil
+	}
+	return Response{Value: strings.TrimPrefix(line, "OK ")}, nil
+}
+
+// BinaryCodec is a length-prefixed, binary codec that carries a
+// request ID on every message, so a client can pipeline several
+// requests ahead of their responses over a single connection.
+type BinaryCodec struct{}
+
+// maxLPLen bounds the length a length-prefixed field decoded by
+// readLP may claim, so a peer can't make it allocate an arbitrary
+// amount of memory by sending a large length header and then little
+// or no data to back it.
+const maxLPLen = 16 << 20 // 16 MiB
+
+// maxPairs bounds the number of Pairs a single Response may claim,
+// for the same reason as maxLPLen.
+const maxPairs = 1 << 20
+
+func writeLP(w io.Writer, s string) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(s)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readLP(r io.Reader) (string, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return "", err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if n > maxLPLen {
+		return "", fmt.Errorf("server: length-prefixed field of %d bytes exceeds the %d byte limit", n, uint32(maxLPLen))
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// rangeFlags packs IncludeStart/IncludeLimit into a single byte.
+func rangeFlags(req Request) byte {
+	var flags byte
+	if req.IncludeStart {
+		flags |= 1
+	}
+	if req.IncludeLimit {
+		flags |= 2
+	}
+	return flags
+}
+
+func (BinaryCodec) WriteRequest(w io.Writer, req Request) error {
+	var header [10]byte
+	binary.BigEndian.PutUint64(header[0:8], req.ID)
+	header[8] = byte(len(req.Op))
+	header[9] = rangeFlags(req)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(req.Op)); err != nil {
+		return err
+	}
+	fields := []string{req.Key, req.Value, req.Xid, req.Bucket, req.RangeStart, req.RangeLimit}
+	for _, s := range fields {
+		if err := writeLP(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (BinaryCodec) ReadRequest(r *bufio.Reader) (Request, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Request{}, err
+	}
+	req := Request{
+		ID:           binary.BigEndian.Uint64(header[0:8]),
+		IncludeStart: header[9]&1 != 0,
+		IncludeLimit: header[9]&2 != 0,
+	}
+	opBuf := make([]byte, header[8])
+	if _, err := io.ReadFull(r, opBuf); err != nil {
+		return Request{}, err
+	}
+	req.Op = Op(opBuf)
+
+	strs := make([]string, 6)
+	for i := range strs {
+		s, err := readLP(r)
+		if err != nil {
+			return Request{}, err
+		}
+		strs[i] = s
+	}
+	req.Key, req.Value, req.Xid, req.Bucket, req.RangeStart, req.RangeLimit = strs[0], strs[1], strs[2], strs[3], strs[4], strs[5]
+	return req, nil
+}
+
+func (BinaryCodec) WriteResponse(w io.Writer, resp Response) error {
+	var header [12]byte
+	binary.BigEndian.PutUint64(header[0:8], resp.ID)
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(resp.Pairs)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if err := writeLP(w, resp.Err); err != nil {
+		return err
+	}
+	if err := writeLP(w, resp.Value); err != nil {
+		return err
+	}
+	for _, p := range resp.Pairs {
+		if err := writeLP(w, p.Key); err != nil {
+			return err
+		}
+		if err := writeLP(w, p.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (BinaryCodec) ReadResponse(r *bufio.Reader) (Response, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Response{}, err
+	}
+	resp := Response{ID: binary.BigEndian.Uint64(header[0:8])}
+	numPairs := binary.BigEndian.Uint32(header[8:12])
+	if numPairs > maxPairs {
+		return Response{}, fmt.Errorf("server: response claims %d pairs, exceeding the %d limit", numPairs, uint32(maxPairs))
+	}
+
+	errStr, err := readLP(r)
+	if err != nil {
+		return Response{}, err
+	}
+	resp.Err = errStr
+	value, err := readLP(r)
+	if err != nil {
+		return Response{}, err
+	}
+	resp.Value = value
+
+	resp.Pairs = make([]Pair, numPairs)
+	for i := range resp.Pairs {
+		key, err := readLP(r)
+		if err != nil {
+			return Response{}, err
+		}
+		val, err := readLP(r)
+		if err != nil {
+			return Response{}, err
+		}
+		resp.Pairs[i] = Pair{Key: key, Value: val}
+	}
+	return resp, nil
+}
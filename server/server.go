@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/devodev/inmemdb"
+)
+
+// Server wraps a *inmemdb.Database and exposes it to TCP clients
+// using a pluggable Codec.
+type Server struct {
+	db    *inmemdb.Database
+	codec Codec
+
+	nextConnID int64
+
+	mu    sync.Mutex
+	conns map[int64]*connState
+}
+
+// connState tracks the transactions a single connection has opened,
+// so that a disconnect can roll them all back instead of leaking
+// them in the Database's activeTransactions.
+type connState struct {
+	mu   sync.Mutex
+	xids map[string]bool
+}
+
+// New wraps db so it can be served over TCP using codec, e.g.
+// server.TextCodec{} or server.BinaryCodec{}.
+func New(db *inmemdb.Database, codec Codec) *Server {
+	return &Server{db: db, codec: codec, conns: make(map[int64]*connState)}
+}
+
+// ListenAndServe listens on addr and serves connections until the
+// listener errors, e.g. because it was closed.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("server: listen: %w", err)
+	}
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	connID := atomic.AddInt64(&s.nextConnID, 1)
+	state := &connState{xids: make(map[string]bool)}
+
+	s.mu.Lock()
+	s.conns[connID] = state
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, connID)
+		s.mu.Unlock()
+
+		state.mu.Lock()
+		xids := make([]string, 0, len(state.xids))
+		for xid := range state.xids {
+			xids = append(xids, xid)
+		}
+		state.mu.Unlock()
+		for _, xid := range xids {
+			_ = s.db.RollbackTransaction(xid)
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		req, err := s.codec.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		resp := s.dispatch(connID, state, req)
+		if err := s.codec.WriteResponse(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// connXid scopes a client-chosen xid to the connection that created
+// it, so two connections can't collide by picking the same name.
+func connXid(connID int64, xid string) string {
+	return fmt.Sprintf("%d:%s", connID, xid)
+}
+
+func (s *Server) dispatch(connID int64, state *connState, req Request) Response {
+	resp := Response{ID: req.ID}
+
+	switch req.Op {
+	case OpGet:
+		if req.Bucket == "" {
+			value, err := s.db.Get(req.Key)
+			return result(req.ID, value, err)
+		}
+		b := s.db.Bucket(req.Bucket)
+		if b == nil {
+			return result(req.ID, "", inmemdb.ErrBucketNotFound)
+		}
+		value, err := b.Get(req.Key)
+		return result(req.ID, value, err)
+	case OpPut:
+		if req.Bucket == "" {
+			return result(req.ID, "", s.db.Put(req.Key, req.Value))
+		}
+		b := s.db.Bucket(req.Bucket)
+		if b == nil {
+			return result(req.ID, "", inmemdb.ErrBucketNotFound)
+		}
+		return result(req.ID, "", b.Put(req.Key, req.Value))
+	case OpDelete:
+		if req.Bucket == "" {
+			return result(req.ID, "", s.db.Delete(req.Key))
+		}
+		b := s.db.Bucket(req.Bucket)
+		if b == nil {
+			return result(req.ID, "", inmemdb.ErrBucketNotFound)
+		}
+		return result(req.ID, "", b.Delete(req.Key))
+
+	case OpBegin:
+		xid := connXid(connID, req.Xid)
+		err := s.db.CreateTransaction(xid)
+		if err == nil {
+			state.mu.Lock()
+			state.xids[xid] = true
+			state.mu.Unlock()
+		}
+		return result(req.ID, "", err)
+	case OpCommit:
+		xid := connXid(connID, req.Xid)
+		err := s.db.CommitTransaction(xid)
+		state.mu.Lock()
+		delete(state.xids, xid)
+		state.mu.Unlock()
+		return result(req.ID, "", err)
+	case OpRollback:
+		xid := connXid(connID, req.Xid)
+		err := s.db.RollbackTransaction(xid)
+		state.mu.Lock()
+		delete(state.xids, xid)
+		state.mu.Unlock()
+		return result(req.ID, "", err)
+
+	case OpGetTxn:
+		if req.Bucket == "" {
+			value, err := s.db.GetTxn(req.Key, connXid(connID, req.Xid))
+			return result(req.ID, value, err)
+		}
+		tx, err := s.db.Transaction(connXid(connID, req.Xid))
+		if err != nil {
+			return result(req.ID, "", err)
+		}
+		value, err := tx.Bucket(req.Bucket).Get(req.Key)
+		return result(req.ID, value, err)
+	case OpPutTxn:
+		if req.Bucket == "" {
+			return result(req.ID, "", s.db.PutTxn(req.Key, req.Value, connXid(connID, req.Xid)))
+		}
+		tx, err := s.db.Transaction(connXid(connID, req.Xid))
+		if err != nil {
+			return result(req.ID, "", err)
+		}
+		return result(req.ID, "", tx.Bucket(req.Bucket).Put(req.Key, req.Value))
+	case OpDeleteTxn:
+		if req.Bucket == "" {
+			return result(req.ID, "", s.db.DeleteTxn(req.Key, connXid(connID, req.Xid)))
+		}
+		tx, err := s.db.Transaction(connXid(connID, req.Xid))
+		if err != nil {
+			return result(req.ID, "", err)
+		}
+		return result(req.ID, "", tx.Bucket(req.Bucket).Delete(req.Key))
+
+	case OpCreateBucket:
+		_, err := s.db.CreateBucket(req.Bucket)
+		return result(req.ID, "", err)
+
+	case OpScan:
+		return s.scan(connID, req)
+
+	default:
+		resp.Err = fmt.Sprintf("unknown op %q", req.Op)
+		return resp
+	}
+}
+
+// scan materializes an Iterator over the range/bucket/transaction
+// combination req describes, into a Response carrying the matched
+// pairs. Bucket-scoped scans inside a transaction aren't supported:
+// BucketTxn has no NewIterator, since the underlying inmemdb package
+// doesn't expose one either.
+func (s *Server) scan(connID int64, req Request) Response {
+	rng := inmemdb.Range{
+		Start:        req.RangeStart,
+		Limit:        req.RangeLimit,
+		IncludeStart: req.IncludeStart,
+		IncludeLimit: req.IncludeLimit,
+	}
+
+	var it inmemdb.Iterator
+	switch {
+	case req.Xid != "" && req.Bucket != "":
+		return result(req.ID, "", fmt.Errorf("server: bucket scans are not supported within a transaction"))
+	case req.Xid != "":
+		tx, err := s.db.Transaction(connXid(connID, req.Xid))
+		if err != nil {
+			return result(req.ID, "", err)
+		}
+		it = tx.NewIterator(rng)
+	case req.Bucket != "":
+		b := s.db.Bucket(req.Bucket)
+		if b == nil {
+			return result(req.ID, "", inmemdb.ErrBucketNotFound)
+		}
+		it = b.NewIterator(rng)
+	default:
+		it = s.db.NewIterator(rng)
+	}
+	defer it.Close()
+
+	var pairs []Pair
+	for it.Next() {
+		pairs = append(pairs, Pair{Key: it.Key(), Value: it.Value()})
+	}
+	if err := it.Err(); err != nil {
+		return result(req.ID, "", err)
+	}
+	return Response{ID: req.ID, Pairs: pairs}
+}
+
+func result(id uint64, value string, err error) Response {
+	if err != nil {
+		return Response{ID: id, Err: err.Error()}
+	}
+	return Response{ID: id, Value: value}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/devodev/inmemdb"
+)
+
+// TestServeConnRollsBackOnDisconnect verifies the mechanism the
+// "network protocol" request called out as necessary: a transaction
+// left open by a connection that goes away must not leak forever in
+// Database.activeTransactions. It talks the wire protocol directly,
+// bypassing the client package, since that package imports server
+// and would otherwise create an import cycle in this in-package test.
+func TestServeConnRollsBackOnDisconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("got error listening but should have got nil: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	db := inmemdb.NewDatabase()
+	s := New(db, BinaryCodec{})
+	go func() {
+		_ = s.ListenAndServe(addr)
+	}()
+
+	conn, err := dialRetry(addr)
+	if err != nil {
+		t.Fatalf("could not connect to %s: %v", addr, err)
+	}
+
+	codec := BinaryCodec{}
+	if err := codec.WriteRequest(conn, Request{ID: 1, Op: OpBegin, Xid: "tx1"}); err != nil {
+		t.Fatalf("got error writing BEGIN request but should have got nil: %v", err)
+	}
+	resp, err := codec.ReadResponse(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("got error reading BEGIN response but should have got nil: %v", err)
+	}
+	if resp.Err != "" {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", resp.Err)
+	}
+
+	// This is the only connection the server has accepted, so it was
+	// assigned connID 1: the transaction is registered under "1:tx1".
+	xid := connXid(1, "tx1")
+	if _, err := db.Transaction(xid); err != nil {
+		t.Fatalf("got error looking up %q right after CreateTransaction but should have got nil: %v", xid, err)
+	}
+
+	conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := db.Transaction(xid)
+		if err == inmemdb.ErrTransactionNotFound {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got transaction %q still active a second after disconnect, want it rolled back", xid)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func dialRetry(addr string) (net.Conn, error) {
+	var err error
+	for i := 0; i < 50; i++ {
+		var conn net.Conn
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil, err
+}
@@ -0,0 +1,116 @@
+package server_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/devodev/inmemdb"
+	"github.com/devodev/inmemdb/client"
+	"github.com/devodev/inmemdb/server"
+)
+
+func startServer(t *testing.T, codec server.Codec) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("got error listening but should have got nil: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := server.New(inmemdb.NewDatabase(), codec)
+	go func() {
+		_ = s.ListenAndServe(addr)
+	}()
+	return addr
+}
+
+func TestServerTextCodecRoundTrip(t *testing.T) {
+	addr := startServer(t, server.TextCodec{})
+
+	c := dial(t, addr, server.TextCodec{})
+	defer c.Close()
+
+	if err := c.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	value, err := c.Get("key1")
+	if err != nil {
+		t.Fatalf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+}
+
+func TestServerBinaryCodecTransaction(t *testing.T) {
+	addr := startServer(t, server.BinaryCodec{})
+
+	c := dial(t, addr, server.BinaryCodec{})
+	defer c.Close()
+
+	if err := c.CreateTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+	}
+	if err := c.PutTxn("key1", "value1", "tx1"); err != nil {
+		t.Fatalf("got error on PutTxn but should have got nil: %v", err)
+	}
+	if err := c.CommitTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CommitTransaction but should have got nil: %v", err)
+	}
+	value, err := c.Get("key1")
+	if err != nil {
+		t.Fatalf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+}
+
+func TestServerBinaryCodecBucketAndScan(t *testing.T) {
+	addr := startServer(t, server.BinaryCodec{})
+
+	c := dial(t, addr, server.BinaryCodec{})
+	defer c.Close()
+
+	if err := c.CreateBucket("users"); err != nil {
+		t.Fatalf("got error on CreateBucket but should have got nil: %v", err)
+	}
+	if err := c.BucketPut("users", "key1", "value1"); err != nil {
+		t.Fatalf("got error on BucketPut but should have got nil: %v", err)
+	}
+	if _, err := c.Get("key1"); err == nil {
+		t.Errorf("got nil error, but wanted one: bucket writes must not leak into the default key space")
+	}
+	value, err := c.BucketGet("users", "key1")
+	if err != nil {
+		t.Fatalf("got error on BucketGet but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+
+	if err := c.Put("key2", "value2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	pairs, err := c.Scan("", "", false, false)
+	if err != nil {
+		t.Fatalf("got error on Scan but should have got nil: %v", err)
+	}
+	if len(pairs) != 1 || pairs[0].Key != "key2" {
+		t.Errorf("got pairs: %v, but wanted a single pair for key2", pairs)
+	}
+}
+
+func dial(t *testing.T, addr string, codec server.Codec) *client.Client {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		c, err := client.Dial(addr, codec)
+		if err == nil {
+			return c
+		}
+	}
+	t.Fatalf("could not connect to %s", addr)
+	return nil
+}
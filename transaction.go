@@ -12,28 +12,80 @@ const (
 // UncommitedEntry represents a database entry
 // that is not yet commited.
 type UncommitedEntry struct {
-	oldValue *string
 	newValue *string
 	state    stateType
 }
 
+// TransactionOptions configures the isolation guarantees of a
+// Transaction created via Database.CreateTransactionWithOptions.
+type TransactionOptions struct {
+	// TrackReads enables read-set validation at commit time: besides
+	// the usual write-write check, CommitTransaction also fails with
+	// ErrTransactionDiscrepancy if any key the transaction read through
+	// Get (but never wrote) was committed with a newer version by
+	// someone else in the meantime. This catches read-write conflicts
+	// the default write-only check misses, at the cost of recording a
+	// version per key read, so it is disabled by default. Keys seen
+	// only through NewIterator or a BucketTxn are not tracked.
+	TrackReads bool
+}
+
 // Transaction represents a single unit of work
 // to be performed against a Database.
 //
-// Transaction implements the `read commited` isolation level.
+// Transaction implements the `snapshot isolation` level: reads made
+// through Get observe the database as it was at the seq captured
+// when the transaction was created, regardless of commits that
+// happen concurrently. Writes are only visible to the transaction
+// itself until CommitTransaction succeeds.
 type Transaction struct {
 	id             string
 	db             *Database
+	seq            uint64
+	opts           TransactionOptions
 	uncommitedData map[string]*UncommitedEntry
+
+	// bucketWrites holds the write-sets of any BucketTxn obtained via
+	// Bucket, keyed by bucket name.
+	bucketWrites map[string]map[string]*UncommitedEntry
+
+	// readSeq records, for every key read via Get while opts.TrackReads
+	// is set, the seq of the version observed (0 if the key wasn't
+	// visible at all). It is nil, and never consulted, otherwise.
+	readSeq map[string]uint64
 }
 
 // NewTransaction initializes a transaction and returns it.
-func NewTransaction(id string, db *Database) *Transaction {
-	return &Transaction{
+//
+// seq is the snapshot sequence number the transaction reads from,
+// as captured by Database.CreateTransaction.
+func NewTransaction(id string, db *Database, seq uint64, opts TransactionOptions) *Transaction {
+	t := &Transaction{
 		id:             id,
 		db:             db,
+		seq:            seq,
+		opts:           opts,
 		uncommitedData: make(map[string]*UncommitedEntry),
 	}
+	if opts.TrackReads {
+		t.readSeq = make(map[string]uint64)
+	}
+	return t
+}
+
+// recordRead remembers seq as the version of key observed by a Get,
+// for later validation at commit time. It is a no-op unless
+// opts.TrackReads is set, and never overwrites a key already present
+// in the write-set: that key is already validated by the write-write
+// check regardless.
+func (t *Transaction) recordRead(key string, seq uint64) {
+	if !t.opts.TrackReads {
+		return
+	}
+	if _, ok := t.uncommitedData[key]; ok {
+		return
+	}
+	t.readSeq[key] = seq
 }
 
 // Put updates/creates an uncommitedEntry and adds it to its local cache.
@@ -46,25 +98,24 @@ func (t *Transaction) Put(key string, value string) error {
 		uEntry.newValue = &value
 		return nil
 	}
-	// entry does not exists locally, check if it exists in database.
+	// entry does not exists locally, check if it is visible from the
+	// transaction's snapshot.
 	t.db.mu.Lock()
 	defer t.db.mu.Unlock()
 	if entry, ok := t.db.data[key]; ok {
-		// entry exists in database, create an uncommitedEntry as stateUpdated
-		// using the value retrieved as oldValue.
-		//
-		// oldValue will be used on commitTransaction to verify
-		// if someone updated the value outside the transaction context.
-		uEntry := UncommitedEntry{
-			oldValue: &entry.Value,
-			newValue: &value,
-			state:    stateUpdated,
+		if rec, ok := entry.at(t.seq); ok && !rec.deleted {
+			// entry is visible in the snapshot, create an uncommitedEntry
+			// as stateUpdated.
+			uEntry := UncommitedEntry{
+				newValue: &value,
+				state:    stateUpdated,
+			}
+			t.uncommitedData[key] = &uEntry
+			return nil
 		}
-		t.uncommitedData[key] = &uEntry
-		return nil
 	}
 
-	// entry does not exists as well in the database, so
+	// entry is not visible from the snapshot either, so
 	// create an uncommitedEntry as stateAdded.
 	uEntry := UncommitedEntry{
 		newValue: &value,
@@ -87,28 +138,27 @@ func (t *Transaction) Delete(key string) error {
 		uEntry.newValue = nil
 		return nil
 	}
-	// entry does not exists locally, check if it exists in database
+	// entry does not exists locally, check if it is visible from the
+	// transaction's snapshot.
 	t.db.mu.Lock()
 	defer t.db.mu.Unlock()
 	if entry, ok := t.db.data[key]; ok {
-		// entry exists in database, create an uncommitedEntry as stateDeleted
-		// and sets newValue to nil.
-		//
-		// oldValue will be used on commitTransaction to verify
-		// if someone updated the value outside the transaction context.
-		uEntry := UncommitedEntry{
-			oldValue: &entry.Value,
-			newValue: nil,
-			state:    stateDeleted,
+		if rec, ok := entry.at(t.seq); ok && !rec.deleted {
+			// entry is visible in the snapshot, create an uncommitedEntry
+			// as stateDeleted and sets newValue to nil.
+			uEntry := UncommitedEntry{
+				newValue: nil,
+				state:    stateDeleted,
+			}
+			t.uncommitedData[key] = &uEntry
+			return nil
 		}
-		t.uncommitedData[key] = &uEntry
-		return nil
 	}
 	return ErrKeyNotFound
 }
 
 // Get fetches a value associated to the provided key
-// if it is visible from the transaction context.
+// if it is visible from the transaction's snapshot.
 func (t *Transaction) Get(key string) (string, error) {
 	// entry exists in local cache, check state
 	// if not deleted and return it
@@ -118,12 +168,16 @@ func (t *Transaction) Get(key string) (string, error) {
 		}
 		return *uEntry.newValue, nil
 	}
-	// entry does not exists locally, check if it exists in database
+	// entry does not exists locally, check if it is visible from the
+	// transaction's snapshot.
 	t.db.mu.Lock()
 	defer t.db.mu.Unlock()
 	if entry, ok := t.db.data[key]; ok {
-		// entry exists in database, return it as-is.
-		return entry.Value, nil
+		if rec, ok := entry.at(t.seq); ok && !rec.deleted {
+			t.recordRead(key, rec.seq)
+			return rec.value, nil
+		}
 	}
+	t.recordRead(key, 0)
 	return "", ErrKeyNotFound
 }
@@ -76,6 +76,151 @@ func TestTransaction(t *testing.T) {
 	})
 }
 
+func TestTransactionTrackReads(t *testing.T) {
+	t.Run("pure read conflicts with a concurrent write when enabled", func(t *testing.T) {
+		db := stubDatabase(t)
+		if err := db.Put("key1", "value1"); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+		if err := db.CreateTransactionWithOptions("tx1", TransactionOptions{TrackReads: true}); err != nil {
+			t.Fatalf("got error on CreateTransactionWithOptions but should have got nil: %v", err)
+		}
+		if _, err := db.GetTxn("key1", "tx1"); err != nil {
+			t.Fatalf("got error on GetTxn but should have got nil: %v", err)
+		}
+
+		// a concurrent, unrelated writer commits a newer version of the
+		// key tx1 only read, never wrote.
+		if err := db.Put("key1", "value2"); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+
+		err := db.CommitTransaction("tx1")
+		if err != ErrTransactionDiscrepancy {
+			t.Errorf("got error: %v, but wanted: %v", err, ErrTransactionDiscrepancy)
+		}
+	})
+
+	t.Run("pure read does not conflict when disabled", func(t *testing.T) {
+		db := stubDatabase(t)
+		if err := db.Put("key1", "value1"); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+		if err := db.CreateTransaction("tx1"); err != nil {
+			t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+		}
+		if _, err := db.GetTxn("key1", "tx1"); err != nil {
+			t.Fatalf("got error on GetTxn but should have got nil: %v", err)
+		}
+		if err := db.Put("key1", "value2"); err != nil {
+			t.Fatalf("got error on Put but should have got nil: %v", err)
+		}
+		if err := db.PutTxn("key2", "value3", "tx1"); err != nil {
+			t.Fatalf("got error on PutTxn but should have got nil: %v", err)
+		}
+
+		if err := db.CommitTransaction("tx1"); err != nil {
+			t.Errorf("got error on CommitTransaction but should have got nil: %v", err)
+		}
+	})
+}
+
+func TestTransactionRepeatableRead(t *testing.T) {
+	db := stubDatabase(t)
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.CreateTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+	}
+
+	value, err := db.GetTxn("key1", "tx1")
+	if err != nil {
+		t.Fatalf("got error on GetTxn but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value1")
+	}
+
+	// a concurrent transaction commits a newer version of the same
+	// key while tx1's snapshot is still open.
+	if err := db.Put("key1", "value2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+
+	value, err = db.GetTxn("key1", "tx1")
+	if err != nil {
+		t.Fatalf("got error on GetTxn but should have got nil: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("repeated read observed a version committed after the snapshot was taken: got %v, wanted %v", value, "value1")
+	}
+
+	value, err = db.Get("key1")
+	if err != nil {
+		t.Fatalf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value2")
+	}
+}
+
+func TestDatabaseVacuum(t *testing.T) {
+	db := stubDatabase(t)
+	if err := db.Put("key1", "value1"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.Put("key1", "value2"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+	if err := db.CreateTransaction("tx1"); err != nil {
+		t.Fatalf("got error on CreateTransaction but should have got nil: %v", err)
+	}
+	// tx1's snapshot seq is captured here, after value1 and value2 were
+	// committed but before value3 below.
+	if err := db.Put("key1", "value3"); err != nil {
+		t.Fatalf("got error on Put but should have got nil: %v", err)
+	}
+
+	tx, err := db.Transaction("tx1")
+	if err != nil {
+		t.Fatalf("got error on Transaction but should have got nil: %v", err)
+	}
+	db.Vacuum(tx.seq)
+
+	entry := db.data["key1"]
+	if len(entry.versions) != 2 {
+		t.Fatalf("got %v versions after Vacuum, wanted 2 (the one still live for tx1, plus the latest)", len(entry.versions))
+	}
+
+	// tx1's snapshot read must still see the version committed before
+	// its snapshot was taken, even though an older version (value1)
+	// was trimmed...
+	value, err := db.GetTxn("key1", "tx1")
+	if err != nil {
+		t.Fatalf("got error on GetTxn but should have got nil: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value2")
+	}
+	// ...while a fresh read still observes the latest committed value.
+	value, err = db.Get("key1")
+	if err != nil {
+		t.Fatalf("got error on Get but should have got nil: %v", err)
+	}
+	if value != "value3" {
+		t.Errorf("got value: %v, but wanted: %v", value, "value3")
+	}
+
+	if err := db.RollbackTransaction("tx1"); err != nil {
+		t.Fatalf("got error on RollbackTransaction but should have got nil: %v", err)
+	}
+	db.Vacuum(db.seq)
+	if len(db.data["key1"].versions) != 1 {
+		t.Errorf("got %v versions after Vacuum with no active transaction, wanted 1", len(db.data["key1"].versions))
+	}
+}
+
 func TestTransactionRequestSequence(t *testing.T) {
 	db := stubDatabase(t)
 